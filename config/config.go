@@ -0,0 +1,35 @@
+// Package config defines the configuration consumed by a simulated chain
+// and its EDR runtime.
+package config
+
+import "fmt"
+
+// ChainConfig configures a single simulated chain, including the debugging/
+// tracing, Hardhat-compatibility, and archive-mode surfaces exposed by EDR.
+type ChainConfig struct {
+	// Port is the TCP port the EDR HTTP server listens on.
+	Port int
+
+	// TracerEnabled gates the debug_trace*/debug_storageRangeAt/
+	// debug_getBadBlocks/debug_intermediateRoots namespace.
+	TracerEnabled bool
+
+	// HardhatMode gates the hardhat_*/evm_*/anvil_* compatibility namespace.
+	HardhatMode bool
+
+	// Reexec bounds how many blocks HistoricalEthClient will re-execute
+	// forward from the nearest snapshot to reconstruct state at an older
+	// block, mirroring geth's --gcmode=archive "reexec" flag. A value of 0
+	// is treated as 1 (snapshot every block; no re-execution window).
+	Reexec uint64
+}
+
+// Validate reports whether cfg is well-formed enough to start an EDR server
+// against, so a misconfigured chain fails fast at startup rather than
+// bubbling up as an obscure net/http or tracer error later.
+func (cfg *ChainConfig) Validate() error {
+	if cfg.Port <= 0 {
+		return fmt.Errorf("config: Port must be positive, got %d", cfg.Port)
+	}
+	return nil
+}
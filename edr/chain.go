@@ -0,0 +1,59 @@
+package edr
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum-optimism/supersim/config"
+	"github.com/ethereum-optimism/supersim/statediff"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// chain is the simulated-chain backend EDR dispatches debug/trace,
+// hardhat/anvil, and archive-state requests to. EDR itself only gates
+// requests on cfg.TracerEnabled/cfg.HardhatMode and shapes the JSON-RPC
+// surface; chain owns actually re-executing transactions, mutating state,
+// and tracking block history.
+type chain interface {
+	Config() *config.ChainConfig
+	EthClient() *ethclient.Client
+
+	// SubscribeBlocks delivers the number of every new canonical block.
+	SubscribeBlocks(ctx context.Context) (<-chan uint64, error)
+	StateDiff(ctx context.Context, number uint64) (*statediff.Diff, error)
+
+	TraceTransaction(ctx context.Context, hash common.Hash, cfg *TraceConfig) (*TraceResult, error)
+	TraceCall(ctx context.Context, args json.RawMessage, blockNrOrHash string, cfg *TraceConfig) (*TraceResult, error)
+	TraceBlockByNumber(ctx context.Context, number uint64, cfg *TraceConfig) ([]*TraceResult, error)
+	TraceBlockByHash(ctx context.Context, hash common.Hash, cfg *TraceConfig) ([]*TraceResult, error)
+	StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, addr common.Address, keyStart []byte, maxResult int) (*StorageRangeResult, error)
+	GetBadBlocks(ctx context.Context) ([]*TraceResult, error)
+	IntermediateRoots(ctx context.Context, hash common.Hash, cfg *TraceConfig) ([]common.Hash, error)
+
+	SetNextBlockTimestamp(ctx context.Context, timestamp uint64) error
+	Mine(ctx context.Context, blocks uint64) error
+	ImpersonateAccount(ctx context.Context, addr common.Address) error
+	StopImpersonatingAccount(ctx context.Context, addr common.Address) error
+	SetBalance(ctx context.Context, addr common.Address, balance *big.Int) error
+	SetCode(ctx context.Context, addr common.Address, code []byte) error
+	SetNonce(ctx context.Context, addr common.Address, nonce uint64) error
+	SetStorageAt(ctx context.Context, addr common.Address, slot, value common.Hash) error
+	Reset(ctx context.Context, forkConfig json.RawMessage) error
+	DropTransaction(ctx context.Context, hash common.Hash) error
+	Snapshot(ctx context.Context) (string, error)
+	Revert(ctx context.Context, id string) (bool, error)
+	IncreaseTime(ctx context.Context, seconds uint64) (uint64, error)
+	SetAutomine(ctx context.Context, enabled bool) error
+	SetIntervalMining(ctx context.Context, intervalMs uint64) error
+	SetChainID(ctx context.Context, chainID uint64) error
+	DumpState(ctx context.Context) ([]byte, error)
+	LoadState(ctx context.Context, state []byte) error
+
+	// BlockHashByNumber and StateAtBlock back HistoricalEthClient's archive
+	// queries; SnapshotStateAtBlock backs runSnapshotJob.
+	BlockHashByNumber(ctx context.Context, number uint64) (common.Hash, error)
+	StateAtBlock(ctx context.Context, number uint64, reexec uint64) (*ethclient.Client, error)
+	SnapshotStateAtBlock(ctx context.Context, number uint64) error
+}
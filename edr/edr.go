@@ -1,13 +1,23 @@
 package edr
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum-optimism/supersim/config"
+	"github.com/ethereum-optimism/supersim/statediff"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -18,8 +28,34 @@ type EDR struct {
 	cfg *config.ChainConfig
 
 	closeApp context.CancelCauseFunc
+
+	log     log.Logger
+	server  *http.Server
+	stopped atomic.Bool
+
+	// chain is the simulated chain this EDR instance fronts; all debug/
+	// trace, hardhat/anvil, and archive-state calls ultimately dispatch to
+	// it. See the chain interface in chain.go.
+	chain chain
+
+	tracers   *tracerRegistry
+	statediff *statediff.Service
+
+	// historicalClients caches reconstructed *ethclient.Client instances
+	// keyed by block hash, so repeated archive queries against the same
+	// historical window skip re-running StateAtBlock.
+	historicalClients *lru.Cache[common.Hash, *ethclient.Client]
 }
 
+// defaultHistoricalClientCacheSize bounds how many reconstructed historical
+// states are kept warm at once.
+const defaultHistoricalClientCacheSize = 128
+
+// defaultStateDiffSinkCapacity bounds how many blocks of state diffs
+// statediff.MemorySink retains for the /statediff range-query endpoint when
+// no external sink is configured.
+const defaultStateDiffSinkCapacity = 1024
+
 // TraceResult represents the result of a trace operation
 type TraceResult struct {
 	Type         string          `json:"type"`
@@ -30,28 +66,243 @@ type TraceResult struct {
 	Error        string          `json:"error,omitempty"`
 }
 
-// New creates a new EDR instance
-func New(log log.Logger, closeApp context.CancelCauseFunc, cfg *config.ChainConfig) *EDR {
+// Built-in tracer names understood by TraceConfig.Tracer, mirroring
+// go-ethereum's eth/tracers/native registry.
+const (
+	CallTracer      = "callTracer"
+	PrestateTracer  = "prestateTracer"
+	FourByteTracer  = "4byteTracer"
+	NoopTracer      = "noopTracer"
+	StructLogTracer = ""
+)
+
+// TraceConfig controls how a debug_trace* call re-executes a transaction
+// or block, following the shape of go-ethereum's tracers.TraceConfig.
+type TraceConfig struct {
+	Tracer       string          `json:"tracer,omitempty"`
+	TracerConfig json.RawMessage `json:"tracerConfig,omitempty"`
+	Timeout      string          `json:"timeout,omitempty"`
+	Reexec       *uint64         `json:"reexec,omitempty"`
+
+	// StateOverrides and BlockOverrides let the caller re-execute against
+	// a hypothetical state/header rather than the one actually mined.
+	StateOverrides json.RawMessage `json:"stateOverrides,omitempty"`
+	BlockOverrides json.RawMessage `json:"blockOverrides,omitempty"`
+
+	// StructLog options, only consulted when Tracer is StructLogTracer.
+	DisableStack     bool `json:"disableStack,omitempty"`
+	DisableStorage   bool `json:"disableStorage,omitempty"`
+	DisableMemory    bool `json:"disableMemory,omitempty"`
+	EnableReturnData bool `json:"enableReturnData,omitempty"`
+
+	// customTracer is populated by resolveCustomTracer when Tracer names a
+	// tracer installed via EDR.RegisterTracer; it is never set by callers.
+	// Read it via CustomTracer so packages outside edr (e.g. the chain
+	// re-execution engine that actually drives the step/fault/result/
+	// enter/exit hooks) can see which tracer, if any, was resolved.
+	customTracer *RegisteredTracer
+}
+
+// CustomTracer returns the tracer resolved by resolveCustomTracer for this
+// config, or nil if Tracer named a built-in (or no tracer at all). Only
+// TraceTransaction calls resolveCustomTracer, so the configs handed to
+// TraceCall, TraceBlockByNumber, TraceBlockByHash and IntermediateRoots
+// always report nil here.
+func (c *TraceConfig) CustomTracer() *RegisteredTracer {
+	if c == nil {
+		return nil
+	}
+	return c.customTracer
+}
+
+// StorageRangeResult is the response shape for debug_storageRangeAt.
+type StorageRangeResult struct {
+	Storage map[common.Hash]StorageEntry `json:"storage"`
+	NextKey *common.Hash                 `json:"nextKey"`
+}
+
+// StorageEntry is a single resolved storage slot within a StorageRangeResult.
+type StorageEntry struct {
+	Key   *common.Hash `json:"key"`
+	Value common.Hash  `json:"value"`
+}
+
+// TracerKind identifies how a user-supplied tracer's source should be
+// executed.
+type TracerKind int
+
+const (
+	// TracerKindJS executes source as a JS tracer exposing the standard
+	// step/fault/result/enter/exit hooks over a log/db object pair, the
+	// same shape as go-ethereum's native JS tracer.
+	TracerKindJS TracerKind = iota
+	// TracerKindWASM executes source as a WASM module implementing the
+	// trace_step ABI.
+	TracerKindWASM
+)
+
+// TracerBudget bounds the resources a single custom tracer invocation may
+// consume, so a misbehaving user tracer can't stall or OOM the EDR process.
+type TracerBudget struct {
+	MaxSteps    uint64
+	MaxMemBytes uint64
+}
+
+// DefaultTracerBudget is applied to a registered tracer when none is given.
+var DefaultTracerBudget = TracerBudget{
+	MaxSteps:    50_000_000,
+	MaxMemBytes: 256 * 1024 * 1024,
+}
+
+// NewCounter returns a live, single-use enforcer for b, to be consumed once
+// per opcode step (and once per allocation) by whichever engine drives the
+// tracer's step/fault/result/enter/exit hooks.
+func (b TracerBudget) NewCounter() *TracerStepCounter {
+	return &TracerStepCounter{budget: b}
+}
+
+// TracerStepCounter enforces a TracerBudget across the lifetime of a single
+// trace invocation. It is not safe for concurrent use; one counter backs one
+// in-flight debug_traceTransaction call, the only trace call that resolves
+// custom tracers.
+type TracerStepCounter struct {
+	budget   TracerBudget
+	steps    uint64
+	memBytes uint64
+}
+
+// ConsumeStep records one more executed opcode step, returning an error once
+// the tracer has exceeded its MaxSteps budget.
+func (c *TracerStepCounter) ConsumeStep() error {
+	c.steps++
+	if c.budget.MaxSteps != 0 && c.steps > c.budget.MaxSteps {
+		return fmt.Errorf("tracer exceeded step budget of %d", c.budget.MaxSteps)
+	}
+	return nil
+}
+
+// ConsumeMemory records an additional allocation of n bytes attributed to the
+// tracer, returning an error once cumulative usage exceeds MaxMemBytes.
+func (c *TracerStepCounter) ConsumeMemory(n uint64) error {
+	c.memBytes += n
+	if c.budget.MaxMemBytes != 0 && c.memBytes > c.budget.MaxMemBytes {
+		return fmt.Errorf("tracer exceeded memory budget of %d bytes", c.budget.MaxMemBytes)
+	}
+	return nil
+}
+
+// wasmMagic is the 4-byte header every WASM binary module begins with.
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// validateTracerSource does a cheap, eager sanity check of source before it's
+// stored, so a typo'd or empty payload fails at registration time rather than
+// at the first trace. It does not compile source: running a custom tracer
+// requires an embedded JS/WASM engine, which the chain re-execution engine
+// that drives the tracer's hooks is responsible for providing; this
+// package only owns registration, validation, and budget accounting.
+func validateTracerSource(kind TracerKind, source []byte) error {
+	switch kind {
+	case TracerKindJS:
+		for _, hook := range []string{"step", "fault", "result", "enter", "exit"} {
+			if bytes.Contains(source, []byte(hook)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("js tracer source defines none of step/fault/result/enter/exit")
+	case TracerKindWASM:
+		if !bytes.HasPrefix(source, wasmMagic) {
+			return fmt.Errorf("wasm tracer source missing \\0asm magic header")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown tracer kind: %d", kind)
+	}
+}
+
+// RegisteredTracer holds a user-supplied tracer's source and the sandbox
+// limits it runs under. It is exported so the chain re-execution engine,
+// which owns actually invoking the tracer's hooks, can read it back off a
+// resolved TraceConfig via TraceConfig.CustomTracer.
+type RegisteredTracer struct {
+	Kind   TracerKind
+	Source []byte
+	Budget TracerBudget
+}
+
+// tracerRegistry is the process-local set of tracers installed via
+// EDR.RegisterTracer, looked up by name when a TraceConfig.Tracer doesn't
+// match a built-in.
+type tracerRegistry struct {
+	mu      sync.RWMutex
+	tracers map[string]*RegisteredTracer
+}
+
+func newTracerRegistry() *tracerRegistry {
+	return &tracerRegistry{tracers: make(map[string]*RegisteredTracer)}
+}
+
+func (r *tracerRegistry) register(name string, t *RegisteredTracer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tracers[name] = t
+}
+
+func (r *tracerRegistry) lookup(name string) (*RegisteredTracer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tracers[name]
+	return t, ok
+}
+
+// New creates a new EDR instance fronting c.
+func New(logger log.Logger, closeApp context.CancelCauseFunc, cfg *config.ChainConfig, c chain) *EDR {
 	return &EDR{
-		cfg:      cfg,
-		closeApp: closeApp,
+		cfg:               cfg,
+		closeApp:          closeApp,
+		log:               logger,
+		chain:             c,
+		tracers:           newTracerRegistry(),
+		statediff:         statediff.NewService(statediff.NewMemorySink(defaultStateDiffSinkCapacity)),
+		historicalClients: lru.NewCache[common.Hash, *ethclient.Client](defaultHistoricalClientCacheSize),
 	}
 }
 
-// Start initializes and starts the EDR service
+// Start initializes and starts the EDR service. Statediff streaming and
+// archive snapshotting are best-effort: if the underlying chain can't
+// support block subscriptions, Start logs and continues without them rather
+// than failing the whole server, since trace/debug/hardhat endpoints don't
+// depend on either.
 func (e *EDR) Start(ctx context.Context) error {
+	if err := e.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid chain config: %w", err)
+	}
+
 	mux := http.NewServeMux()
 
 	// Register handlers
 	mux.HandleFunc("/trace", e.handleTrace)
 	mux.HandleFunc("/debug", e.handleDebug)
 	mux.HandleFunc("/hardhat", e.handleHardhat)
+	mux.HandleFunc("/statediff", e.handleStateDiff)
+	mux.HandleFunc("/statediff/subscribe", e.handleStateDiffSubscribe)
 
 	e.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", e.cfg.Port),
 		Handler: mux,
 	}
 
+	if blocks, err := e.chain.SubscribeBlocks(ctx); err != nil {
+		e.log.Error("subscribing to blocks for statediff; statediff streaming disabled", "err", err)
+	} else {
+		go e.streamStateDiffs(ctx, blocks)
+	}
+
+	if snapshotBlocks, err := e.chain.SubscribeBlocks(ctx); err != nil {
+		e.log.Error("subscribing to blocks for archive snapshots; HistoricalEthClient disabled", "err", err)
+	} else {
+		go e.runSnapshotJob(ctx, snapshotBlocks)
+	}
+
 	go func() {
 		e.log.Info("Starting EDR server", "port", e.cfg.Port)
 		if err := e.server.ListenAndServe(); err != http.ErrServerClosed {
@@ -62,6 +313,37 @@ func (e *EDR) Start(ctx context.Context) error {
 	return nil
 }
 
+// streamStateDiffs computes and publishes a statediff.Diff for every
+// canonical block number received on blocks, until ctx is done or blocks is
+// closed.
+func (e *EDR) streamStateDiffs(ctx context.Context, blocks <-chan uint64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case number, ok := <-blocks:
+			if !ok {
+				return
+			}
+			diff, err := e.chain.StateDiff(ctx, number)
+			if err != nil {
+				e.log.Error("computing state diff", "block", number, "err", err)
+				continue
+			}
+			if err := e.statediff.Publish(ctx, diff); err != nil {
+				e.log.Error("publishing state diff", "block", number, "err", err)
+			}
+		}
+	}
+}
+
+// SubscribeStateDiff registers a live subscriber for canonical state diffs,
+// backing the /statediff/subscribe streaming endpoint. It returns an error
+// if params names an encoding the statediff Service can't produce.
+func (e *EDR) SubscribeStateDiff(params statediff.Params) (*statediff.Subscription, error) {
+	return e.statediff.Subscribe(params)
+}
+
 // Stop gracefully shuts down the EDR service
 func (e *EDR) Stop(ctx context.Context) error {
 	if e.stopped.Load() {
@@ -69,6 +351,10 @@ func (e *EDR) Stop(ctx context.Context) error {
 	}
 	defer e.stopped.Store(true)
 
+	if err := e.statediff.Close(); err != nil {
+		e.log.Error("closing statediff service", "err", err)
+	}
+
 	if e.server != nil {
 		e.log.Info("Stopping EDR server")
 		return e.server.Shutdown(ctx)
@@ -76,13 +362,132 @@ func (e *EDR) Stop(ctx context.Context) error {
 	return nil
 }
 
-// TraceTransaction traces a specific transaction
-func (e *EDR) TraceTransaction(ctx context.Context, hash common.Hash) (*TraceResult, error) {
+// TraceTransaction implements debug_traceTransaction: it re-executes a single
+// transaction and returns the trace produced by cfg.Tracer (or the raw
+// struct-log tracer if cfg is nil).
+func (e *EDR) TraceTransaction(ctx context.Context, hash common.Hash, cfg *TraceConfig) (*TraceResult, error) {
 	if !e.cfg.TracerEnabled {
 		return nil, fmt.Errorf("tracing not enabled")
 	}
 
-	return e.chain.TraceTransaction(ctx, hash)
+	if err := e.resolveCustomTracer(cfg); err != nil {
+		return nil, err
+	}
+
+	return e.chain.TraceTransaction(ctx, hash, cfg)
+}
+
+// resolveCustomTracer checks whether cfg names a user-registered tracer and,
+// if so, attaches its registered source/budget so the re-execution path can
+// dispatch to it instead of a built-in. Built-in tracer names and the empty
+// (struct-log) tracer pass through untouched.
+func (e *EDR) resolveCustomTracer(cfg *TraceConfig) error {
+	if cfg == nil || cfg.Tracer == "" {
+		return nil
+	}
+	switch cfg.Tracer {
+	case CallTracer, PrestateTracer, FourByteTracer, NoopTracer:
+		return nil
+	}
+
+	t, ok := e.tracers.lookup(cfg.Tracer)
+	if !ok {
+		return fmt.Errorf("unknown tracer: %s", cfg.Tracer)
+	}
+	cfg.customTracer = t
+	return nil
+}
+
+// RegisterTracer installs a user-supplied tracer under name, making it
+// selectable from TraceConfig.Tracer on subsequent debug_traceTransaction
+// calls. budget bounds the CPU/memory the tracer may consume per call; the
+// zero value of TracerBudget falls back to DefaultTracerBudget.
+//
+// RegisterTracer only validates and stores source; it does not compile or
+// run it. Actually invoking a custom tracer's step/fault/result/enter/exit
+// hooks during re-execution is the chain engine's responsibility, which
+// reads the resolved tracer back via TraceConfig.CustomTracer.
+func (e *EDR) RegisterTracer(name string, source []byte, kind TracerKind, budget TracerBudget) error {
+	if name == "" {
+		return fmt.Errorf("tracer name must not be empty")
+	}
+	switch name {
+	case CallTracer, PrestateTracer, FourByteTracer, NoopTracer:
+		return fmt.Errorf("tracer name %q shadows a built-in tracer", name)
+	}
+	if len(source) == 0 {
+		return fmt.Errorf("tracer source must not be empty")
+	}
+	if err := validateTracerSource(kind, source); err != nil {
+		return fmt.Errorf("invalid tracer source: %w", err)
+	}
+	if budget == (TracerBudget{}) {
+		budget = DefaultTracerBudget
+	}
+
+	e.tracers.register(name, &RegisteredTracer{Kind: kind, Source: source, Budget: budget})
+	return nil
+}
+
+// TraceCall implements debug_traceCall: it traces a message call without
+// requiring it to have been mined, re-executed on top of the given block.
+func (e *EDR) TraceCall(ctx context.Context, args json.RawMessage, blockNrOrHash string, cfg *TraceConfig) (*TraceResult, error) {
+	if !e.cfg.TracerEnabled {
+		return nil, fmt.Errorf("tracing not enabled")
+	}
+
+	return e.chain.TraceCall(ctx, args, blockNrOrHash, cfg)
+}
+
+// TraceBlockByNumber implements debug_traceBlockByNumber: it traces every
+// transaction in the block, in order, and returns one TraceResult per tx.
+func (e *EDR) TraceBlockByNumber(ctx context.Context, number uint64, cfg *TraceConfig) ([]*TraceResult, error) {
+	if !e.cfg.TracerEnabled {
+		return nil, fmt.Errorf("tracing not enabled")
+	}
+
+	return e.chain.TraceBlockByNumber(ctx, number, cfg)
+}
+
+// TraceBlockByHash implements debug_traceBlockByHash, identical to
+// TraceBlockByNumber but addressed by block hash.
+func (e *EDR) TraceBlockByHash(ctx context.Context, hash common.Hash, cfg *TraceConfig) ([]*TraceResult, error) {
+	if !e.cfg.TracerEnabled {
+		return nil, fmt.Errorf("tracing not enabled")
+	}
+
+	return e.chain.TraceBlockByHash(ctx, hash, cfg)
+}
+
+// StorageRangeAt implements debug_storageRangeAt: it returns at most maxResult
+// storage slots for the given account at the state produced after executing
+// txIndex transactions within the block.
+func (e *EDR) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, addr common.Address, keyStart []byte, maxResult int) (*StorageRangeResult, error) {
+	if !e.cfg.TracerEnabled {
+		return nil, fmt.Errorf("tracing not enabled")
+	}
+
+	return e.chain.StorageRangeAt(ctx, blockHash, txIndex, addr, keyStart, maxResult)
+}
+
+// GetBadBlocks implements debug_getBadBlocks, returning the most recent
+// blocks the local chain rejected along with the validation error.
+func (e *EDR) GetBadBlocks(ctx context.Context) ([]*TraceResult, error) {
+	if !e.cfg.TracerEnabled {
+		return nil, fmt.Errorf("tracing not enabled")
+	}
+
+	return e.chain.GetBadBlocks(ctx)
+}
+
+// IntermediateRoots implements debug_intermediateRoots: it re-executes a
+// block and returns the state root after each transaction.
+func (e *EDR) IntermediateRoots(ctx context.Context, hash common.Hash, cfg *TraceConfig) ([]common.Hash, error) {
+	if !e.cfg.TracerEnabled {
+		return nil, fmt.Errorf("tracing not enabled")
+	}
+
+	return e.chain.IntermediateRoots(ctx, hash, cfg)
 }
 
 // Debug provides debugging information for a transaction or block
@@ -109,7 +514,7 @@ func (e *EDR) handleTrace(w http.ResponseWriter, r *http.Request) {
 	}
 
 	hash := common.HexToHash(req.TxHash)
-	result, err := e.TraceTransaction(r.Context(), hash)
+	result, err := e.TraceTransaction(r.Context(), hash, nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -118,6 +523,414 @@ func (e *EDR) handleTrace(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
+// handleStateDiff implements the /statediff?from=X&to=Y range endpoint: it
+// returns every retained diff in the inclusive block range [from, to] when a
+// ReplayableSink is configured, or 501 if diffs aren't being persisted. It
+// answers at once with what the sink holds; it does not hold the request
+// open waiting for blocks in the range that have not been published yet.
+func (e *EDR) handleStateDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sink, ok := e.statediff.Sink().(statediff.ReplayableSink)
+	if !ok {
+		http.Error(w, "statediff persistence not configured", http.StatusNotImplemented)
+		return
+	}
+
+	from, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.ParseUint(r.URL.Query().Get("to"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if to < from {
+		http.Error(w, "to must be >= from", http.StatusBadRequest)
+		return
+	}
+
+	diffs, err := sink.ReadDiffs(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(diffs)
+}
+
+// handleStateDiffSubscribe implements /statediff/subscribe: a long-lived,
+// newline-delimited-JSON stream of every statediff.Diff published from the
+// moment of connection onward, optionally restricted to
+// ?address=0x..&address=0x... Non-leaf storage entries are dropped unless
+// ?intermediateNodes=true is given. This is the live
+// delivery channel backing SubscribeStateDiff over plain HTTP, since the EDR
+// server doesn't run a WebSocket endpoint.
+func (e *EDR) handleStateDiffSubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var addresses []common.Address
+	for _, a := range r.URL.Query()["address"] {
+		addresses = append(addresses, common.HexToAddress(a))
+	}
+	params := statediff.Params{
+		WatchedAddresses:  addresses,
+		IntermediateNodes: r.URL.Query().Get("intermediateNodes") == "true",
+	}
+
+	sub, err := e.SubscribeStateDiff(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case diff, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(diff); err != nil {
+				e.log.Error("writing statediff subscription entry", "err", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// rpcRequest is the JSON-RPC 2.0 envelope accepted by handleDebug and
+// handleHardhat, so existing wallet/Foundry/Hardhat JSON-RPC clients can
+// point at either namespace transparently.
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcResponse is the JSON-RPC 2.0 envelope handleDebug and handleHardhat
+// reply with; exactly one of Result or Error is populated.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// Standard JSON-RPC 2.0 error codes, per the spec.
+const (
+	rpcErrParseError     = -32700
+	rpcErrMethodNotFound = -32601
+	rpcErrInternal       = -32603
+)
+
+// methodNotFoundError is returned by dispatchDebugMethod/dispatchHardhatMethod
+// when method names a namespace member that doesn't exist, so callers can
+// report it as a JSON-RPC "method not found" error rather than a generic one.
+type methodNotFoundError struct{ method string }
+
+func (e *methodNotFoundError) Error() string { return fmt.Sprintf("unknown method: %s", e.method) }
+
+// writeRPCResult writes a successful JSON-RPC 2.0 response.
+func writeRPCResult(w http.ResponseWriter, id json.RawMessage, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rpcResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// writeRPCError writes a JSON-RPC 2.0 error response. Per spec this still
+// uses HTTP 200; the error is surfaced in the body, not the status line.
+func writeRPCError(w http.ResponseWriter, id json.RawMessage, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}})
+}
+
+// dispatchErrorCode classifies an error returned by a dispatch*Method call
+// into the matching JSON-RPC error code.
+func dispatchErrorCode(err error) int {
+	var notFound *methodNotFoundError
+	if errors.As(err, &notFound) {
+		return rpcErrMethodNotFound
+	}
+	return rpcErrInternal
+}
+
+func (e *EDR) handleDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRPCError(w, nil, rpcErrParseError, err.Error())
+		return
+	}
+
+	result, err := e.dispatchDebugMethod(r.Context(), req.Method, req.Params)
+	if err != nil {
+		writeRPCError(w, req.ID, dispatchErrorCode(err), err.Error())
+		return
+	}
+
+	writeRPCResult(w, req.ID, result)
+}
+
+// dispatchDebugMethod routes a single debug_* RPC call to the matching EDR
+// method, decoding params positionally the way go-ethereum's rpc package
+// does for its own namespaces.
+func (e *EDR) dispatchDebugMethod(ctx context.Context, method string, params []json.RawMessage) (interface{}, error) {
+	switch method {
+	case "debug_traceTransaction":
+		var hash common.Hash
+		cfg := &TraceConfig{}
+		if err := decodeParams(params, &hash, cfg); err != nil {
+			return nil, err
+		}
+		return e.TraceTransaction(ctx, hash, cfg)
+	case "debug_traceCall":
+		var args json.RawMessage
+		var blockNrOrHash string
+		cfg := &TraceConfig{}
+		if err := decodeParams(params, &args, &blockNrOrHash, cfg); err != nil {
+			return nil, err
+		}
+		return e.TraceCall(ctx, args, blockNrOrHash, cfg)
+	case "debug_traceBlockByNumber":
+		var number uint64
+		cfg := &TraceConfig{}
+		if err := decodeParams(params, &number, cfg); err != nil {
+			return nil, err
+		}
+		return e.TraceBlockByNumber(ctx, number, cfg)
+	case "debug_traceBlockByHash":
+		var hash common.Hash
+		cfg := &TraceConfig{}
+		if err := decodeParams(params, &hash, cfg); err != nil {
+			return nil, err
+		}
+		return e.TraceBlockByHash(ctx, hash, cfg)
+	case "debug_storageRangeAt":
+		var blockHash common.Hash
+		var txIndex int
+		var addr common.Address
+		var keyStart hexutil.Bytes
+		var maxResult int
+		if err := decodeParams(params, &blockHash, &txIndex, &addr, &keyStart, &maxResult); err != nil {
+			return nil, err
+		}
+		return e.StorageRangeAt(ctx, blockHash, txIndex, addr, keyStart, maxResult)
+	case "debug_getBadBlocks":
+		return e.GetBadBlocks(ctx)
+	case "debug_intermediateRoots":
+		var hash common.Hash
+		cfg := &TraceConfig{}
+		if err := decodeParams(params, &hash, cfg); err != nil {
+			return nil, err
+		}
+		return e.IntermediateRoots(ctx, hash, cfg)
+	default:
+		return nil, &methodNotFoundError{method: method}
+	}
+}
+
+// decodeParams unmarshals positional JSON-RPC params into dst, tolerating
+// calls that omit trailing optional arguments (e.g. TraceConfig).
+func decodeParams(params []json.RawMessage, dst ...interface{}) error {
+	for i, d := range dst {
+		if i >= len(params) {
+			return nil
+		}
+		if err := json.Unmarshal(params[i], d); err != nil {
+			return fmt.Errorf("invalid param %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// handleHardhat serves the full hardhat_*/evm_*/anvil_* compatibility
+// surface over the same method/params envelope as handleDebug, gated by
+// hardhatMode.
+func (e *EDR) handleHardhat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRPCError(w, nil, rpcErrParseError, err.Error())
+		return
+	}
+
+	result, err := e.dispatchHardhatMethod(r.Context(), req.Method, req.Params)
+	if err != nil {
+		writeRPCError(w, req.ID, dispatchErrorCode(err), err.Error())
+		return
+	}
+
+	writeRPCResult(w, req.ID, result)
+}
+
+// dispatchHardhatMethod routes a single hardhat_*/evm_*/anvil_* RPC call to
+// the matching EDR method. Methods with no return value respond with `true`
+// on success, matching Hardhat's own JSON-RPC convention.
+func (e *EDR) dispatchHardhatMethod(ctx context.Context, method string, params []json.RawMessage) (interface{}, error) {
+	switch method {
+	case "evm_setNextBlockTimestamp":
+		var timestamp uint64
+		if err := decodeParams(params, &timestamp); err != nil {
+			return nil, err
+		}
+		return true, e.SetNextBlockTimestamp(ctx, timestamp)
+	case "evm_mine":
+		// An optional timestamp param sets the mined block's timestamp.
+		if len(params) > 0 {
+			var timestamp uint64
+			if err := decodeParams(params, &timestamp); err != nil {
+				return nil, err
+			}
+			if err := e.SetNextBlockTimestamp(ctx, timestamp); err != nil {
+				return nil, err
+			}
+		}
+		return true, e.Mine(ctx, 1)
+	case "hardhat_impersonateAccount":
+		var addr common.Address
+		if err := decodeParams(params, &addr); err != nil {
+			return nil, err
+		}
+		return true, e.ImpersonateAccount(ctx, addr)
+	case "hardhat_stopImpersonatingAccount":
+		var addr common.Address
+		if err := decodeParams(params, &addr); err != nil {
+			return nil, err
+		}
+		return true, e.StopImpersonatingAccount(ctx, addr)
+	case "hardhat_setBalance":
+		var addr common.Address
+		var balanceHex string
+		if err := decodeParams(params, &addr, &balanceHex); err != nil {
+			return nil, err
+		}
+		balance, ok := new(big.Int).SetString(balanceHex, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid balance: %s", balanceHex)
+		}
+		return true, e.SetBalance(ctx, addr, balance)
+	case "hardhat_setCode":
+		var addr common.Address
+		var code hexutil.Bytes
+		if err := decodeParams(params, &addr, &code); err != nil {
+			return nil, err
+		}
+		return true, e.SetCode(ctx, addr, code)
+	case "hardhat_setNonce":
+		var addr common.Address
+		var nonce uint64
+		if err := decodeParams(params, &addr, &nonce); err != nil {
+			return nil, err
+		}
+		return true, e.SetNonce(ctx, addr, nonce)
+	case "hardhat_setStorageAt":
+		var addr common.Address
+		var slot, value common.Hash
+		if err := decodeParams(params, &addr, &slot, &value); err != nil {
+			return nil, err
+		}
+		return true, e.SetStorageAt(ctx, addr, slot, value)
+	case "hardhat_reset":
+		var forkConfig json.RawMessage
+		if err := decodeParams(params, &forkConfig); err != nil {
+			return nil, err
+		}
+		return true, e.Reset(ctx, forkConfig)
+	case "hardhat_dropTransaction":
+		var hash common.Hash
+		if err := decodeParams(params, &hash); err != nil {
+			return nil, err
+		}
+		return true, e.DropTransaction(ctx, hash)
+	case "evm_snapshot":
+		return e.Snapshot(ctx)
+	case "evm_revert":
+		var id string
+		if err := decodeParams(params, &id); err != nil {
+			return nil, err
+		}
+		return e.Revert(ctx, id)
+	case "evm_increaseTime":
+		var seconds uint64
+		if err := decodeParams(params, &seconds); err != nil {
+			return nil, err
+		}
+		return e.IncreaseTime(ctx, seconds)
+	case "evm_setAutomine":
+		var enabled bool
+		if err := decodeParams(params, &enabled); err != nil {
+			return nil, err
+		}
+		return true, e.SetAutomine(ctx, enabled)
+	case "evm_setIntervalMining":
+		var intervalMs uint64
+		if err := decodeParams(params, &intervalMs); err != nil {
+			return nil, err
+		}
+		return true, e.SetIntervalMining(ctx, intervalMs)
+	case "anvil_setChainId":
+		var chainID uint64
+		if err := decodeParams(params, &chainID); err != nil {
+			return nil, err
+		}
+		return true, e.SetChainID(ctx, chainID)
+	case "anvil_dumpState":
+		state, err := e.DumpState(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Encode as a 0x-prefixed hex string, not base64, so the result
+		// round-trips straight back through anvil_loadState's hexutil.Bytes
+		// param.
+		return hexutil.Bytes(state), nil
+	case "anvil_loadState":
+		var state hexutil.Bytes
+		if err := decodeParams(params, &state); err != nil {
+			return nil, err
+		}
+		return true, e.LoadState(ctx, state)
+	default:
+		return nil, &methodNotFoundError{method: method}
+	}
+}
+
 // Hardhat compatibility methods
 
 func (e *EDR) SetNextBlockTimestamp(ctx context.Context, timestamp uint64) error {
@@ -134,6 +947,130 @@ func (e *EDR) Mine(ctx context.Context, blocks uint64) error {
 	return e.chain.Mine(ctx, blocks)
 }
 
+func (e *EDR) ImpersonateAccount(ctx context.Context, addr common.Address) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.ImpersonateAccount(ctx, addr)
+}
+
+func (e *EDR) StopImpersonatingAccount(ctx context.Context, addr common.Address) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.StopImpersonatingAccount(ctx, addr)
+}
+
+func (e *EDR) SetBalance(ctx context.Context, addr common.Address, balance *big.Int) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetBalance(ctx, addr, balance)
+}
+
+func (e *EDR) SetCode(ctx context.Context, addr common.Address, code []byte) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetCode(ctx, addr, code)
+}
+
+func (e *EDR) SetNonce(ctx context.Context, addr common.Address, nonce uint64) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetNonce(ctx, addr, nonce)
+}
+
+func (e *EDR) SetStorageAt(ctx context.Context, addr common.Address, slot, value common.Hash) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetStorageAt(ctx, addr, slot, value)
+}
+
+// Reset re-initializes the chain, optionally re-forking from the given
+// config. A nil forkConfig resets to an empty, non-forked chain.
+func (e *EDR) Reset(ctx context.Context, forkConfig json.RawMessage) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.Reset(ctx, forkConfig)
+}
+
+func (e *EDR) DropTransaction(ctx context.Context, hash common.Hash) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.DropTransaction(ctx, hash)
+}
+
+// Snapshot pushes the current chain state onto a copy-on-write snapshot
+// stack and returns its id, for use with Revert. Unlike a full state copy,
+// both the snapshot and a subsequent revert are O(diff) against the
+// underlying state trie.
+func (e *EDR) Snapshot(ctx context.Context) (string, error) {
+	if !e.cfg.HardhatMode {
+		return "", fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.Snapshot(ctx)
+}
+
+// Revert pops state back to the snapshot identified by id. It returns false
+// if id does not correspond to a live snapshot.
+func (e *EDR) Revert(ctx context.Context, id string) (bool, error) {
+	if !e.cfg.HardhatMode {
+		return false, fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.Revert(ctx, id)
+}
+
+func (e *EDR) IncreaseTime(ctx context.Context, seconds uint64) (uint64, error) {
+	if !e.cfg.HardhatMode {
+		return 0, fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.IncreaseTime(ctx, seconds)
+}
+
+func (e *EDR) SetAutomine(ctx context.Context, enabled bool) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetAutomine(ctx, enabled)
+}
+
+// SetIntervalMining configures the chain to mine a block every intervalMs
+// milliseconds. An interval of 0 disables interval mining.
+func (e *EDR) SetIntervalMining(ctx context.Context, intervalMs uint64) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetIntervalMining(ctx, intervalMs)
+}
+
+func (e *EDR) SetChainID(ctx context.Context, chainID uint64) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.SetChainID(ctx, chainID)
+}
+
+// DumpState serializes the full chain state (accounts, storage, and block
+// history) so it can be restored later via LoadState.
+func (e *EDR) DumpState(ctx context.Context) ([]byte, error) {
+	if !e.cfg.HardhatMode {
+		return nil, fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.DumpState(ctx)
+}
+
+func (e *EDR) LoadState(ctx context.Context, state []byte) error {
+	if !e.cfg.HardhatMode {
+		return fmt.Errorf("hardhat mode not enabled")
+	}
+	return e.chain.LoadState(ctx, state)
+}
+
 // Helper methods
 
 func (e *EDR) Endpoint() string {
@@ -153,3 +1090,60 @@ func (e *EDR) Config() *config.ChainConfig {
 func (e *EDR) EthClient() *ethclient.Client {
 	return e.chain.EthClient()
 }
+
+// HistoricalEthClient returns an ethclient.Client answering eth_call,
+// eth_getBalance, eth_getStorageAt, eth_getCode, and eth_getProof against
+// state reconstructed as of blockNumber, by re-executing forward from the
+// nearest snapshot within e.cfg.Reexec blocks — the same reexec-window
+// traversal geth's StateAtBlock uses for archive queries. Reconstructed
+// clients are cached by block hash so repeated queries in the same
+// historical window are cheap.
+func (e *EDR) HistoricalEthClient(ctx context.Context, blockNumber uint64) (*ethclient.Client, error) {
+	hash, err := e.chain.BlockHashByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("resolving block %d: %w", blockNumber, err)
+	}
+
+	if client, ok := e.historicalClients.Get(hash); ok {
+		return client, nil
+	}
+
+	reexec := e.cfg.Reexec
+	if reexec == 0 {
+		reexec = 1
+	}
+	client, err := e.chain.StateAtBlock(ctx, blockNumber, reexec)
+	if err != nil {
+		return nil, fmt.Errorf("reconstructing state at block %d: %w", blockNumber, err)
+	}
+
+	e.historicalClients.Add(hash, client)
+	return client, nil
+}
+
+// runSnapshotJob periodically records a full-state snapshot every
+// e.cfg.Reexec blocks so HistoricalEthClient never has to re-execute more
+// than one reexec window to reach any historical block.
+func (e *EDR) runSnapshotJob(ctx context.Context, blocks <-chan uint64) {
+	reexec := e.cfg.Reexec
+	if reexec == 0 {
+		reexec = 1
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case number, ok := <-blocks:
+			if !ok {
+				return
+			}
+			if number%reexec != 0 {
+				continue
+			}
+			if err := e.chain.SnapshotStateAtBlock(ctx, number); err != nil {
+				e.log.Error("snapshotting state for archive queries", "block", number, "err", err)
+			}
+		}
+	}
+}
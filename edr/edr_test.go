@@ -0,0 +1,91 @@
+package edr
+
+import "testing"
+
+func TestTracerRegistryRegisterLookup(t *testing.T) {
+	r := newTracerRegistry()
+
+	if _, ok := r.lookup("myTracer"); ok {
+		t.Fatalf("lookup on empty registry should miss")
+	}
+
+	want := &RegisteredTracer{Kind: TracerKindJS, Source: []byte("function step() {}"), Budget: DefaultTracerBudget}
+	r.register("myTracer", want)
+
+	got, ok := r.lookup("myTracer")
+	if !ok {
+		t.Fatalf("lookup should find a registered tracer")
+	}
+	if got != want {
+		t.Fatalf("lookup returned %v, want %v", got, want)
+	}
+}
+
+func TestValidateTracerSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    TracerKind
+		source  []byte
+		wantErr bool
+	}{
+		{"js with step hook", TracerKindJS, []byte("function step(log, db) {}"), false},
+		{"js with no hooks", TracerKindJS, []byte("var x = 1;"), true},
+		{"wasm with magic header", TracerKindWASM, []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, false},
+		{"wasm missing magic header", TracerKindWASM, []byte("not wasm"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTracerSource(tt.kind, tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateTracerSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTracerStepCounterConsumeStep(t *testing.T) {
+	c := TracerBudget{MaxSteps: 2}.NewCounter()
+
+	if err := c.ConsumeStep(); err != nil {
+		t.Fatalf("step 1: unexpected error: %v", err)
+	}
+	if err := c.ConsumeStep(); err != nil {
+		t.Fatalf("step 2: unexpected error: %v", err)
+	}
+	if err := c.ConsumeStep(); err == nil {
+		t.Fatalf("step 3: expected budget exceeded error")
+	}
+}
+
+func TestTracerStepCounterConsumeMemory(t *testing.T) {
+	c := TracerBudget{MaxMemBytes: 100}.NewCounter()
+
+	if err := c.ConsumeMemory(60); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.ConsumeMemory(60); err == nil {
+		t.Fatalf("expected budget exceeded error after 120 bytes against a 100 byte budget")
+	}
+}
+
+func TestRegisterTracerRejectsInvalidSource(t *testing.T) {
+	e := &EDR{tracers: newTracerRegistry()}
+
+	if err := e.RegisterTracer("myTracer", []byte("no hooks here"), TracerKindJS, TracerBudget{}); err == nil {
+		t.Fatalf("expected an error registering a tracer with no recognizable hooks")
+	}
+	if _, ok := e.tracers.lookup("myTracer"); ok {
+		t.Fatalf("invalid tracer source must not be registered")
+	}
+}
+
+func TestDecodeParamsToleratesMissingTrailingArgs(t *testing.T) {
+	var a, b string
+	if err := decodeParams(nil, &a, &b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a != "" || b != "" {
+		t.Fatalf("expected zero values, got a=%q b=%q", a, b)
+	}
+}
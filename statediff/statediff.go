@@ -0,0 +1,311 @@
+// Package statediff computes structured per-block state diffs for the EDR
+// runtime and publishes them to subscribers, mirroring the plugeth
+// statediff service so the local dev chain can double as an indexing
+// source for L2 dev workflows.
+package statediff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Encoding names the wire format a subscriber asks for in Params. Service
+// hands subscribers and the Sink *Diff values and does not marshal them
+// itself; Subscribe accepts only EncodingJSON.
+type Encoding int
+
+const (
+	// EncodingJSON is plain JSON.
+	EncodingJSON Encoding = iota
+	// EncodingIPLDCBOR is IPLD-CBOR, plugeth's on-disk statediff
+	// representation. This package has no IPLD-CBOR encoder, and Subscribe
+	// rejects it.
+	EncodingIPLDCBOR
+)
+
+// AccountDiff describes how a single account changed between two blocks.
+type AccountDiff struct {
+	Address common.Address `json:"address"`
+	Created bool           `json:"created"`
+	Deleted bool           `json:"deleted"`
+
+	NonceBefore   uint64      `json:"nonceBefore"`
+	NonceAfter    uint64      `json:"nonceAfter"`
+	BalanceBefore string      `json:"balanceBefore"`
+	BalanceAfter  string      `json:"balanceAfter"`
+	CodeChanged   bool        `json:"codeChanged"`
+	CodeHashAfter common.Hash `json:"codeHashAfter"`
+
+	Storage []StorageDiff `json:"storage,omitempty"`
+}
+
+// StorageDiff describes how a single storage slot changed.
+type StorageDiff struct {
+	Key    common.Hash `json:"key"`
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+	Leaf   bool        `json:"leaf"`
+}
+
+// Diff is the full state transition produced by a single canonical block.
+type Diff struct {
+	BlockNumber uint64        `json:"blockNumber"`
+	BlockHash   common.Hash   `json:"blockHash"`
+	ParentHash  common.Hash   `json:"parentHash"`
+	Accounts    []AccountDiff `json:"accounts"`
+	Receipts    []common.Hash `json:"receipts"`
+	TraceRoot   *common.Hash  `json:"traceRoot,omitempty"`
+}
+
+// Params filters and shapes the diffs a subscriber receives.
+type Params struct {
+	// WatchedAddresses restricts diffs to these accounts; empty means all.
+	WatchedAddresses []common.Address
+	// IntermediateNodes includes intermediate trie nodes rather than only
+	// leaves when true.
+	IntermediateNodes bool
+	Encoding          Encoding
+}
+
+// Sink persists diffs for later replay, e.g. to Postgres or SQLite.
+type Sink interface {
+	WriteDiff(ctx context.Context, d *Diff) error
+	Close() error
+}
+
+// ReplayableSink is a Sink that can additionally answer range queries,
+// backing the /statediff?from=X&to=Y range endpoint.
+type ReplayableSink interface {
+	Sink
+	ReadDiffs(ctx context.Context, from, to uint64) ([]*Diff, error)
+}
+
+// MemorySink is a Sink that keeps the most recent diffs in an in-process
+// ring buffer. It's the default persistence backend: enough to make the
+// /statediff range-query endpoint actually work without standing up
+// Postgres/SQLite, at the cost of not surviving a restart and only
+// retaining the last capacity blocks.
+type MemorySink struct {
+	mu       sync.Mutex
+	capacity int
+	byNumber map[uint64]*Diff
+	order    []uint64
+}
+
+// NewMemorySink creates a MemorySink retaining at most capacity diffs,
+// evicting the oldest once full. A capacity <= 0 is treated as 1.
+func NewMemorySink(capacity int) *MemorySink {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &MemorySink{capacity: capacity, byNumber: make(map[uint64]*Diff)}
+}
+
+// WriteDiff implements Sink.
+func (m *MemorySink) WriteDiff(_ context.Context, d *Diff) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.byNumber[d.BlockNumber]; !exists {
+		m.order = append(m.order, d.BlockNumber)
+	}
+	m.byNumber[d.BlockNumber] = d
+
+	for len(m.order) > m.capacity {
+		oldest := m.order[0]
+		m.order = m.order[1:]
+		delete(m.byNumber, oldest)
+	}
+	return nil
+}
+
+// ReadDiffs implements ReplayableSink, returning every retained diff with
+// BlockNumber in [from, to]. Diffs evicted for capacity are simply absent
+// from the result, not an error.
+//
+// This walks m.order (bounded by capacity) rather than the [from, to] range
+// itself, so an arbitrarily wide or even wraparound-prone range (e.g.
+// from=0, to=math.MaxUint64) costs at most one pass over the retained diffs
+// instead of looping over the requested range.
+func (m *MemorySink) ReadDiffs(_ context.Context, from, to uint64) ([]*Diff, error) {
+	if from > to {
+		return nil, fmt.Errorf("statediff: invalid range [%d, %d]: from must be <= to", from, to)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []*Diff
+	for _, number := range m.order {
+		if number < from || number > to {
+			continue
+		}
+		if d, ok := m.byNumber[number]; ok {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].BlockNumber < out[j].BlockNumber })
+	return out, nil
+}
+
+// Close implements Sink. MemorySink holds no external resources.
+func (m *MemorySink) Close() error { return nil }
+
+// Subscription is a live feed of diffs for one subscriber, returned by
+// Service.Subscribe. The channel is closed when Unsubscribe is called or
+// the Service is closed.
+type Subscription struct {
+	C <-chan *Diff
+
+	service *Service
+	id      uint64
+}
+
+// Unsubscribe stops delivery and releases the subscription's channel.
+func (s *Subscription) Unsubscribe() {
+	s.service.unsubscribe(s.id)
+}
+
+// Service fans out every Diff handed to Publish, one per canonical block, to
+// subscribers filtered by their own Params. It does not compute diffs itself.
+type Service struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[uint64]*subscriber
+	sink   Sink
+}
+
+type subscriber struct {
+	params Params
+	ch     chan *Diff
+}
+
+// NewService creates a Service. sink may be nil, in which case diffs are
+// only fanned out to live subscribers and not persisted.
+func NewService(sink Sink) *Service {
+	return &Service{
+		subs: make(map[uint64]*subscriber),
+		sink: sink,
+	}
+}
+
+// Subscribe registers a new subscriber and returns a Subscription whose
+// channel receives every future Diff matching params. It returns an error if
+// params names an encoding this Service can't produce.
+func (s *Service) Subscribe(params Params) (*Subscription, error) {
+	if params.Encoding == EncodingIPLDCBOR {
+		return nil, fmt.Errorf("statediff: IPLD-CBOR encoding is not yet implemented")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	id := s.nextID
+	ch := make(chan *Diff, 16)
+	s.subs[id] = &subscriber{params: params, ch: ch}
+
+	return &Subscription{C: ch, service: s, id: id}, nil
+}
+
+func (s *Service) unsubscribe(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub, ok := s.subs[id]; ok {
+		close(sub.ch)
+		delete(s.subs, id)
+	}
+}
+
+// Publish computes the diff's delivery to every matching subscriber and, if
+// a Sink is configured, persists it. It is called once per canonical block
+// produced by the underlying chain.
+func (s *Service) Publish(ctx context.Context, d *Diff) error {
+	if s.sink != nil {
+		if err := s.sink.WriteDiff(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subs {
+		filtered := filterDiff(d, sub.params)
+		select {
+		case sub.ch <- filtered:
+		default:
+			// Slow subscriber; drop rather than block block production.
+		}
+	}
+	return nil
+}
+
+// Sink returns the Service's configured persistence sink, or nil if none was
+// set.
+func (s *Service) Sink() Sink {
+	return s.sink
+}
+
+// Close unsubscribes every live subscriber and closes the configured Sink,
+// if any.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	for id, sub := range s.subs {
+		close(sub.ch)
+		delete(s.subs, id)
+	}
+	s.mu.Unlock()
+
+	if s.sink != nil {
+		return s.sink.Close()
+	}
+	return nil
+}
+
+// filterDiff applies a subscriber's Params to a Diff, restricting accounts
+// to WatchedAddresses and dropping intermediate storage entries when the
+// subscriber only wants leaves.
+func filterDiff(d *Diff, params Params) *Diff {
+	if len(params.WatchedAddresses) == 0 && params.IntermediateNodes {
+		return d
+	}
+
+	watched := make(map[common.Address]bool, len(params.WatchedAddresses))
+	for _, a := range params.WatchedAddresses {
+		watched[a] = true
+	}
+
+	out := &Diff{
+		BlockNumber: d.BlockNumber,
+		BlockHash:   d.BlockHash,
+		ParentHash:  d.ParentHash,
+		Receipts:    d.Receipts,
+		TraceRoot:   d.TraceRoot,
+	}
+	for _, acc := range d.Accounts {
+		if len(watched) > 0 && !watched[acc.Address] {
+			continue
+		}
+		if !params.IntermediateNodes {
+			// acc.Storage aliases the backing array shared by d and every
+			// other subscriber's (and the Sink's) copy of this diff, so the
+			// leaves-only slice must be built into a fresh array rather than
+			// compacted in place with acc.Storage[:0].
+			leaves := make([]StorageDiff, 0, len(acc.Storage))
+			for _, sd := range acc.Storage {
+				if sd.Leaf {
+					leaves = append(leaves, sd)
+				}
+			}
+			acc.Storage = leaves
+		}
+		out.Accounts = append(out.Accounts, acc)
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package statediff
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func testDiff(number uint64) *Diff {
+	addr := common.HexToAddress("0x1")
+	return &Diff{
+		BlockNumber: number,
+		BlockHash:   common.HexToHash("0xaa"),
+		Accounts: []AccountDiff{
+			{
+				Address: addr,
+				Storage: []StorageDiff{
+					{Key: common.HexToHash("0x1"), Leaf: true},
+					{Key: common.HexToHash("0x2"), Leaf: false},
+				},
+			},
+		},
+	}
+}
+
+func TestFilterDiffNoParamsPassesThrough(t *testing.T) {
+	d := testDiff(1)
+	out := filterDiff(d, Params{IntermediateNodes: true})
+	if out != d {
+		t.Fatalf("expected the original diff to pass through unfiltered")
+	}
+}
+
+func TestFilterDiffDropsNonLeavesByDefault(t *testing.T) {
+	d := testDiff(1)
+	out := filterDiff(d, Params{})
+	if len(out.Accounts) != 1 {
+		t.Fatalf("expected 1 account, got %d", len(out.Accounts))
+	}
+	if len(out.Accounts[0].Storage) != 1 || !out.Accounts[0].Storage[0].Leaf {
+		t.Fatalf("expected only the leaf storage entry to survive, got %+v", out.Accounts[0].Storage)
+	}
+}
+
+func TestFilterDiffRestrictsToWatchedAddresses(t *testing.T) {
+	d := testDiff(1)
+	out := filterDiff(d, Params{WatchedAddresses: []common.Address{common.HexToAddress("0xdead")}})
+	if len(out.Accounts) != 0 {
+		t.Fatalf("expected no accounts to match an unwatched address, got %d", len(out.Accounts))
+	}
+}
+
+func TestSubscribeRejectsUnsupportedEncoding(t *testing.T) {
+	s := NewService(nil)
+	if _, err := s.Subscribe(Params{Encoding: EncodingIPLDCBOR}); err == nil {
+		t.Fatalf("expected an error subscribing with EncodingIPLDCBOR")
+	}
+}
+
+func TestPublishDeliversToSubscribers(t *testing.T) {
+	s := NewService(nil)
+	sub, err := s.Subscribe(Params{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := s.Publish(context.Background(), testDiff(1)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case d := <-sub.C:
+		if d.BlockNumber != 1 {
+			t.Fatalf("expected block 1, got %d", d.BlockNumber)
+		}
+	default:
+		t.Fatalf("expected a diff to be delivered to the subscriber")
+	}
+}
+
+func TestPublishWritesToSink(t *testing.T) {
+	sink := NewMemorySink(10)
+	s := NewService(sink)
+
+	if err := s.Publish(context.Background(), testDiff(5)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diffs, err := sink.ReadDiffs(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].BlockNumber != 5 {
+		t.Fatalf("expected to read back block 5, got %+v", diffs)
+	}
+}
+
+func TestPublishDoesNotCorruptSinkCopyViaFilteringSubscriber(t *testing.T) {
+	sink := NewMemorySink(10)
+	s := NewService(sink)
+
+	// A subscriber that drops non-leaf storage entries must not mutate the
+	// same backing array the Sink (and any other subscriber) sees, since
+	// Publish hands every consumer the same *Diff.
+	sub, err := s.Subscribe(Params{IntermediateNodes: false})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := s.Publish(context.Background(), testDiff(7)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diffs, err := sink.ReadDiffs(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	storage := diffs[0].Accounts[0].Storage
+	if len(storage) != 2 {
+		t.Fatalf("expected the sink's copy to retain both storage entries, got %+v", storage)
+	}
+	if !storage[0].Leaf || storage[1].Leaf {
+		t.Fatalf("expected the sink's copy to be untouched (leaf, non-leaf), got %+v", storage)
+	}
+}
+
+func TestMemorySinkReadDiffsRejectsInvertedRange(t *testing.T) {
+	sink := NewMemorySink(10)
+	if _, err := sink.ReadDiffs(context.Background(), 10, 5); err == nil {
+		t.Fatalf("expected an error reading a range with from > to")
+	}
+}
+
+func TestMemorySinkReadDiffsHandlesHugeRangeInBoundedTime(t *testing.T) {
+	sink := NewMemorySink(4)
+	ctx := context.Background()
+	for i := uint64(1); i <= 3; i++ {
+		if err := sink.WriteDiff(ctx, testDiff(i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// A range this wide would loop forever (and wrap on overflow) if
+	// ReadDiffs iterated [from, to] directly instead of the retained diffs.
+	diffs, err := sink.ReadDiffs(ctx, 0, ^uint64(0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs, got %d", len(diffs))
+	}
+	for i, d := range diffs {
+		if d.BlockNumber != uint64(i+1) {
+			t.Fatalf("expected diffs sorted by block number, got %+v", diffs)
+		}
+	}
+}
+
+func TestMemorySinkEvictsOldestBeyondCapacity(t *testing.T) {
+	sink := NewMemorySink(2)
+	ctx := context.Background()
+
+	for i := uint64(1); i <= 3; i++ {
+		if err := sink.WriteDiff(ctx, testDiff(i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	diffs, err := sink.ReadDiffs(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs retained at capacity 2, got %d", len(diffs))
+	}
+	if diffs[0].BlockNumber == 1 {
+		t.Fatalf("expected block 1 to have been evicted, got %+v", diffs)
+	}
+}